@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// writeFile writes an archive's contents to outputFile, wrapping any error
+// the way the rest of this package does.
+func writeFile(outputFile string, data []byte) error {
+	if err := os.WriteFile(outputFile, data, 0644); err != nil {
+		return fmt.Errorf("error writing archive %s: %v", outputFile, err)
+	}
+	return nil
+}
+
+// ArchiveMode selects a self-contained, single-file output format for a
+// page instead of the usual on-disk mirror tree.
+type ArchiveMode string
+
+const (
+	ArchiveNone       ArchiveMode = ""
+	ArchiveMHTML      ArchiveMode = "mhtml"
+	ArchiveSingleHTML ArchiveMode = "single-html"
+)
+
+// ParseArchiveMode validates a -archive flag value.
+func ParseArchiveMode(s string) (ArchiveMode, error) {
+	switch ArchiveMode(s) {
+	case ArchiveNone, ArchiveMHTML, ArchiveSingleHTML:
+		return ArchiveMode(s), nil
+	default:
+		return "", fmt.Errorf("unknown archive mode %q (want %q or %q)", s, ArchiveMHTML, ArchiveSingleHTML)
+	}
+}
+
+// archivePage fetches urlStr and its assets and writes a single
+// self-contained file in the requested mode, returning the path written.
+func archivePage(urlStr string, mode ArchiveMode) (string, error) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %s: %v", urlStr, err)
+	}
+
+	body, err := httpFetcher.Get(urlStr)
+	if err != nil {
+		return "", err
+	}
+
+	doc, assets, err := parsePage(string(body))
+	if err != nil {
+		return "", fmt.Errorf("error parsing %s: %v", urlStr, err)
+	}
+
+	switch mode {
+	case ArchiveMHTML:
+		return writeMHTML(parsedURL, body, assets)
+	case ArchiveSingleHTML:
+		return writeSingleHTML(parsedURL, doc, assets)
+	default:
+		return "", fmt.Errorf("unknown archive mode %q", mode)
+	}
+}
+
+// archiveFileName flattens a page URL into a single file name (no
+// directories), since an archive is always exactly one file.
+func archiveFileName(parsedURL *url.URL, ext string) string {
+	p := strings.Trim(parsedURL.Path, "/")
+	if p == "" {
+		p = "index"
+	}
+	p = strings.ReplaceAll(p, "/", "_")
+	return parsedURL.Hostname() + "_" + p + "." + ext
+}
+
+// fetchAsset resolves and fetches the body of an asset reference, reporting
+// ok=false (and logging) for data URIs, non-http(s) schemes, or fetch
+// failures, so callers can just skip it.
+func fetchAsset(base *url.URL, rawURL string) (resolved *url.URL, body []byte, ok bool) {
+	if isDataURI(rawURL) {
+		return nil, nil, false
+	}
+	resolved, err := resolveURL(base, rawURL)
+	if err != nil {
+		return nil, nil, false
+	}
+	body, err = httpFetcher.GetMeta(resolved.String(), FetchMeta{SourcePage: base.String()})
+	if err != nil {
+		reporter.Errorf("failed to fetch %s for archive: %v", resolved, err)
+		return nil, nil, false
+	}
+	return resolved, body, true
+}
+
+// guessMimeType prefers the extension-derived MIME type (matching what a
+// browser would expect from the original URL) and falls back to sniffing
+// the content.
+func guessMimeType(path string, data []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return strings.SplitN(t, ";", 2)[0]
+	}
+	return http.DetectContentType(data)
+}
+
+// writeMHTML bundles the page and its assets into an RFC 2557
+// multipart/related MHTML file: the page body is stored unmodified as the
+// root part, and every asset is attached as a further part keyed by its
+// absolute URL in Content-Location, so a reader resolves references exactly
+// as the original page did.
+func writeMHTML(parsedURL *url.URL, pageBody []byte, assets []Asset) (string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	if err := writeMHTMLPart(mw, parsedURL.String(), "text/html; charset=utf-8", pageBody); err != nil {
+		return "", err
+	}
+
+	seen := map[string]bool{parsedURL.String(): true}
+	for _, a := range assets {
+		if a.Kind == AssetLink {
+			continue
+		}
+		for _, rawURL := range srcsetURLs(a) {
+			resolved, assetBody, ok := fetchAsset(parsedURL, rawURL)
+			if !ok || seen[resolved.String()] {
+				continue
+			}
+			seen[resolved.String()] = true
+			mimeType := guessMimeType(resolved.Path, assetBody)
+			if a.Kind == AssetStylesheet {
+				assetBody = inlineCSSForMHTML(mw, resolved, assetBody, seen)
+			}
+			if err := writeMHTMLPart(mw, resolved.String(), mimeType, assetBody); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return "", fmt.Errorf("error closing MHTML archive: %v", err)
+	}
+
+	out := fmt.Sprintf("MIME-Version: 1.0\r\nContent-Type: multipart/related; boundary=%q; type=\"text/html\"\r\n\r\n%s",
+		mw.Boundary(), buf.String())
+
+	outputFile := archiveFileName(parsedURL, "mhtml")
+	if err := writeFile(outputFile, []byte(out)); err != nil {
+		return "", err
+	}
+	return outputFile, nil
+}
+
+// inlineCSSForMHTML fetches the url(...)/@import references inside a
+// downloaded stylesheet and attaches each as its own MHTML part, so the
+// stylesheet body itself needs no rewriting: its relative/absolute
+// references still resolve via the parts' Content-Location.
+func inlineCSSForMHTML(mw *multipart.Writer, cssURL *url.URL, cssBody []byte, seen map[string]bool) []byte {
+	for _, ref := range extractCSSRefs(string(cssBody)) {
+		resolved, assetBody, ok := fetchAsset(cssURL, ref.RawURL)
+		if !ok || seen[resolved.String()] {
+			continue
+		}
+		seen[resolved.String()] = true
+		mimeType := guessMimeType(resolved.Path, assetBody)
+		if err := writeMHTMLPart(mw, resolved.String(), mimeType, assetBody); err != nil {
+			reporter.Errorf("failed to attach %s to archive: %v", resolved, err)
+		}
+	}
+	return cssBody
+}
+
+// srcsetURLs returns the URL(s) an Asset stands for: a single RawURL for
+// everything except AssetSrcset, which packs several candidate URLs into
+// one attribute value.
+func srcsetURLs(a Asset) []string {
+	if a.Kind != AssetSrcset {
+		return []string{a.RawURL}
+	}
+	var urls []string
+	for _, candidate := range strings.Split(a.RawURL, ",") {
+		fields := strings.Fields(strings.TrimSpace(candidate))
+		if len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// writeMHTMLPart writes one MIME part of an MHTML archive, base64-encoding
+// its body.
+func writeMHTMLPart(mw *multipart.Writer, location, mimeType string, data []byte) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mimeType)
+	header.Set("Content-Location", location)
+	header.Set("Content-Transfer-Encoding", "base64")
+
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("error creating MHTML part for %s: %v", location, err)
+	}
+	if _, err := part.Write(base64Lines(data)); err != nil {
+		return fmt.Errorf("error writing MHTML part for %s: %v", location, err)
+	}
+	return nil
+}
+
+// base64Lines base64-encodes data and wraps it at 76 columns, as RFC 2045
+// requires for base64 content-transfer-encoding.
+func base64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var out bytes.Buffer
+	for i := 0; i < len(encoded); i += 76 {
+		end := i + 76
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		out.WriteString(encoded[i:end])
+		out.WriteString("\r\n")
+	}
+	return out.Bytes()
+}
+
+// writeSingleHTML inlines every asset the page references directly into the
+// document - images and media as data: URIs, stylesheets as <style> blocks
+// with their own url(...) references inlined in turn - and writes the
+// result as one ordinary HTML file.
+func writeSingleHTML(parsedURL *url.URL, doc *html.Node, assets []Asset) (string, error) {
+	for _, a := range assets {
+		switch a.Kind {
+		case AssetLink:
+			// External navigation target: nothing to inline, leave as-is.
+		case AssetStylesheet:
+			inlineStylesheetNode(parsedURL, a.Node)
+		case AssetSrcset:
+			setAttr(a.Node, a.Attr, inlineSrcset(parsedURL, a.RawURL))
+		default:
+			if resolved, data, ok := fetchAsset(parsedURL, a.RawURL); ok {
+				setAttr(a.Node, a.Attr, dataURI(guessMimeType(resolved.Path, data), data))
+			}
+		}
+	}
+
+	inlineInlineCSS(doc, parsedURL)
+
+	rendered, err := renderPage(doc)
+	if err != nil {
+		return "", fmt.Errorf("error rendering archive: %v", err)
+	}
+
+	outputFile := archiveFileName(parsedURL, "html")
+	if err := writeFile(outputFile, []byte(rendered)); err != nil {
+		return "", err
+	}
+	return outputFile, nil
+}
+
+// inlineStylesheetNode replaces a <link rel=stylesheet> node in place with
+// an equivalent <style> node holding the fetched CSS, its own url(...)/
+// @import references inlined as data: URIs.
+func inlineStylesheetNode(base *url.URL, link *html.Node) {
+	href, ok := nodeAttr(link, "href")
+	if !ok {
+		return
+	}
+	resolved, body, ok := fetchAsset(base, href)
+	if !ok {
+		return
+	}
+
+	css := inlineCSSBlob(resolved, string(body))
+
+	style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+	style.AppendChild(&html.Node{Type: html.TextNode, Data: css})
+	if link.Parent != nil {
+		link.Parent.InsertBefore(style, link)
+		link.Parent.RemoveChild(link)
+	}
+}
+
+// inlineSrcset fetches every candidate URL in a srcset attribute value and
+// rewrites it to a data: URI.
+func inlineSrcset(base *url.URL, raw string) string {
+	candidates := strings.Split(raw, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(strings.TrimSpace(candidate))
+		if len(fields) == 0 {
+			continue
+		}
+		resolved, data, ok := fetchAsset(base, fields[0])
+		if !ok {
+			continue
+		}
+		fields[0] = dataURI(guessMimeType(resolved.Path, data), data)
+		candidates[i] = " " + strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ",")
+}
+
+// inlineInlineCSS walks the DOM for style="" attributes and <style>
+// elements already present in the page and inlines any url(...) references
+// they contain as data: URIs.
+func inlineInlineCSS(n *html.Node, base *url.URL) {
+	if n.Type == html.ElementNode {
+		if style, ok := nodeAttr(n, "style"); ok && strings.Contains(style, "url(") {
+			setAttr(n, "style", inlineCSSBlob(base, style))
+		}
+		if n.DataAtom == atom.Style && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+			n.FirstChild.Data = inlineCSSBlob(base, n.FirstChild.Data)
+		}
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		inlineInlineCSS(child, base)
+	}
+}
+
+// inlineCSSBlob fetches every url(...)/@import reference in a CSS blob and
+// rewrites it to a data: URI, recursing into any reference that is itself a
+// stylesheet (e.g. an @import chain) so its own url(...) references are
+// resolved against data too, rather than being baked unresolved into an
+// opaque data: URI.
+func inlineCSSBlob(base *url.URL, cssSrc string) string {
+	return inlineCSSBlobCached(base, cssSrc, map[string]string{})
+}
+
+// inlineCSSBlobCached is inlineCSSBlob's recursive worker. cache maps a
+// resolved reference to its already-computed data: URI, so a stylesheet
+// referenced more than once - including through an @import cycle - is only
+// fetched and recursed into once, with every occurrence still getting the
+// fully-recursed result rather than the first one recursing and the rest
+// falling back to the shallow, un-recursed bytes.
+func inlineCSSBlobCached(base *url.URL, cssSrc string, cache map[string]string) string {
+	mapping := make(map[string]string)
+	for _, ref := range extractCSSRefs(cssSrc) {
+		resolved, data, ok := fetchAsset(base, ref.RawURL)
+		if !ok {
+			continue
+		}
+		key := resolved.String()
+		if uri, ok := cache[key]; ok {
+			mapping[ref.RawURL] = uri
+			continue
+		}
+		cache[key] = "" // claimed before recursing, so an @import cycle terminates here
+		if isCSS(resolved.Path, data) {
+			data = []byte(inlineCSSBlobCached(resolved, string(data), cache))
+		}
+		uri := dataURI(guessMimeType(resolved.Path, data), data)
+		cache[key] = uri
+		mapping[ref.RawURL] = uri
+	}
+	if len(mapping) == 0 {
+		return cssSrc
+	}
+	return rewriteCSS(cssSrc, mapping)
+}
+
+// isCSS reports whether a fetched reference is itself a stylesheet, by
+// extension or sniffed content type.
+func isCSS(path string, data []byte) bool {
+	return guessMimeType(path, data) == "text/css"
+}
+
+// dataURI encodes data as a data: URI of the given MIME type.
+func dataURI(mimeType string, data []byte) string {
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data))
+}
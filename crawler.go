@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// crawlTask is a single page fetch queued for a worker. source is the page
+// that linked here ("" for the seed), used to attribute progress/log events
+// to the page that caused the fetch.
+type crawlTask struct {
+	url    string
+	depth  int
+	source string
+}
+
+// Crawler walks a site starting from a seed URL, following same-host links
+// (plus any explicitly allowed domains) up to maxDepth, using a bounded pool
+// of workers. It reuses fetchAndSavePage/processHTMLContent for the actual
+// fetch-and-rewrite work on each page.
+type Crawler struct {
+	baseDir      string
+	convertLinks bool
+	workers      int
+	maxDepth     int
+	outer        bool
+	seedHost     string
+	allowHosts   map[string]bool
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	visited map[string]bool
+	queue   []crawlTask
+	closed  bool
+
+	wg sync.WaitGroup
+
+	errMu sync.Mutex
+	errs  []error
+}
+
+// NewCrawler builds a Crawler. allowDomains is only consulted when outer is
+// false; it lets the crawl step outside the seed host onto a short allowlist
+// (e.g. a CDN or asset subdomain) without opening it up to the whole web.
+func NewCrawler(baseDir string, workers, maxDepth int, outer bool, allowDomains []string, convertLinks bool) *Crawler {
+	allow := make(map[string]bool, len(allowDomains))
+	for _, d := range allowDomains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d != "" {
+			allow[d] = true
+		}
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	c := &Crawler{
+		baseDir:      baseDir,
+		convertLinks: convertLinks,
+		workers:      workers,
+		maxDepth:     maxDepth,
+		outer:        outer,
+		allowHosts:   allow,
+		visited:      make(map[string]bool),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Run crawls starting at seedURL and blocks until every reachable page within
+// maxDepth has been fetched.
+func (c *Crawler) Run(seedURL string) error {
+	parsedSeed, err := url.Parse(seedURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %v", seedURL, err)
+	}
+	c.seedHost = parsedSeed.Hostname()
+
+	for i := 0; i < c.workers; i++ {
+		go c.worker()
+	}
+
+	c.enqueue(seedURL, 0, "")
+
+	// wg reaches zero once every enqueued task (and every task it in turn
+	// enqueued) has finished processing, at which point it's safe to stop
+	// the workers.
+	c.wg.Wait()
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.cond.Broadcast()
+
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if len(c.errs) > 0 {
+		return fmt.Errorf("%d page(s) failed, first error: %v", len(c.errs), c.errs[0])
+	}
+	return nil
+}
+
+func (c *Crawler) worker() {
+	for {
+		task, ok := c.dequeue()
+		if !ok {
+			return
+		}
+		c.process(task)
+		c.wg.Done()
+	}
+}
+
+// dequeue blocks until a task is available or the crawl has finished (no
+// more tasks will ever be enqueued), in which case it returns false.
+func (c *Crawler) dequeue() (crawlTask, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.queue) == 0 && !c.closed {
+		c.cond.Wait()
+	}
+	if len(c.queue) == 0 {
+		return crawlTask{}, false
+	}
+	task := c.queue[0]
+	c.queue = c.queue[1:]
+	return task, true
+}
+
+// enqueue normalizes and dedupes url, then schedules it for fetching if it
+// hasn't been visited yet. The queue is an unbounded slice rather than a
+// fixed-capacity channel, so a wide crawl's frontier can never grow large
+// enough to deadlock a blocking send against the very workers meant to
+// drain it.
+func (c *Crawler) enqueue(rawURL string, depth int, source string) {
+	normalized, err := normalizeURL(rawURL)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.visited[normalized] {
+		c.mu.Unlock()
+		return
+	}
+	c.visited[normalized] = true
+	c.queue = append(c.queue, crawlTask{url: normalized, depth: depth, source: source})
+	pending := len(c.queue)
+	c.mu.Unlock()
+
+	reporter.SetQueueDepth(pending)
+	c.wg.Add(1)
+	c.cond.Signal()
+}
+
+func (c *Crawler) process(task crawlTask) {
+	pageMeta := FetchMeta{SourcePage: task.source, Depth: task.depth}
+
+	outputFile, targetDir, body, err := fetchAndSavePage(task.url, c.baseDir, c.convertLinks, pageMeta)
+	if err != nil {
+		c.recordErr(err)
+		return
+	}
+
+	// Assets on this page are attributed to the page itself, not to
+	// whatever page linked here.
+	assetMeta := FetchMeta{SourcePage: task.url, Depth: task.depth}
+	links, err := processHTMLContent(body, outputFile, task.url, targetDir, assetMeta, c.hostAllowed)
+	if err != nil {
+		c.recordErr(err)
+		return
+	}
+
+	if task.depth >= c.maxDepth {
+		return
+	}
+	for _, link := range links {
+		linkURL, err := url.Parse(link)
+		if err != nil || (linkURL.Scheme != "http" && linkURL.Scheme != "https") {
+			continue
+		}
+		if !c.hostAllowed(linkURL.Hostname()) {
+			continue
+		}
+		c.enqueue(link, task.depth+1, task.url)
+	}
+}
+
+func (c *Crawler) hostAllowed(host string) bool {
+	if c.outer {
+		return true
+	}
+	if strings.EqualFold(host, c.seedHost) {
+		return true
+	}
+	return c.allowHosts[strings.ToLower(host)]
+}
+
+func (c *Crawler) recordErr(err error) {
+	reporter.Errorf("%v", err)
+	c.errMu.Lock()
+	c.errs = append(c.errs, err)
+	c.errMu.Unlock()
+}
+
+// normalizeURL canonicalizes a URL for visited-set dedup: it drops the
+// fragment and normalizes an empty path to "/".
+func normalizeURL(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	parsed.Fragment = ""
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	return parsed.String(), nil
+}
+
+// pagePath maps a page URL to the relative mirrored file path it should be
+// saved under, rooted at the hostname directory. A query string is hashed
+// into the filename (the same way candidatePath does for assets) so that
+// pages differing only by query - distinct, both legitimately crawled
+// pages - don't collide on the same output file.
+func pagePath(parsedURL *url.URL) string {
+	p := parsedURL.Path
+	switch {
+	case p == "" || strings.HasSuffix(p, "/"):
+		p += "index.html"
+	case filepath.Ext(p) == "":
+		p += "/index.html"
+	}
+	p = withQueryHash(p, parsedURL.RawQuery)
+	return filepath.Join(parsedURL.Hostname(), strings.TrimPrefix(p, "/"))
+}
+
+// linkRelPath computes the path, relative to the directory containing
+// filePath, that a link to pageURL should use once pageURL itself has been
+// (or will be) mirrored under targetDir's mirror root.
+func linkRelPath(filePath, targetDir string, pageURL *url.URL) (string, error) {
+	mirrorRoot := filepath.Dir(targetDir)
+	relPath, err := filepath.Rel(filepath.Dir(filePath), filepath.Join(mirrorRoot, pagePath(pageURL)))
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(relPath), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+)
+
+// cssRef is a single url(...) or @import reference found while tokenizing
+// CSS, either a full stylesheet or the value of a style="" attribute.
+type cssRef struct {
+	RawURL string
+}
+
+// extractCSSRefs tokenizes CSS source and returns every url(...)/@import
+// reference it contains, skipping data: URIs. It's used both for standalone
+// .css files and for inline style="" attributes and <style> blocks.
+func extractCSSRefs(cssSrc string) []cssRef {
+	var refs []cssRef
+	lexer := css.NewLexer(parse.NewInputString(cssSrc))
+	prevAtImport := false
+	for {
+		tt, data := lexer.Next()
+		if tt == css.ErrorToken {
+			break
+		}
+		text := string(data)
+		switch tt {
+		case css.AtKeywordToken:
+			prevAtImport = strings.EqualFold(text, "@import")
+		case css.WhitespaceToken, css.CommentToken:
+			// preserve prevAtImport across whitespace/comments between
+			// "@import" and its string/url argument
+		case css.URLToken:
+			if raw, ok := unwrapURLToken(text); ok && !isDataURI(raw) {
+				refs = append(refs, cssRef{RawURL: raw})
+			}
+			prevAtImport = false
+		case css.StringToken:
+			if prevAtImport {
+				if raw := unwrapQuotes(text); raw != "" && !isDataURI(raw) {
+					refs = append(refs, cssRef{RawURL: raw})
+				}
+			}
+			prevAtImport = false
+		default:
+			prevAtImport = false
+		}
+	}
+	return refs
+}
+
+// rewriteCSS re-lexes cssSrc and rebuilds it token-by-token, substituting
+// any url(...)/@import reference present in mapping with its local path.
+func rewriteCSS(cssSrc string, mapping map[string]string) string {
+	var out strings.Builder
+	lexer := css.NewLexer(parse.NewInputString(cssSrc))
+	prevAtImport := false
+	for {
+		tt, data := lexer.Next()
+		if tt == css.ErrorToken {
+			break
+		}
+		text := string(data)
+		switch tt {
+		case css.AtKeywordToken:
+			prevAtImport = strings.EqualFold(text, "@import")
+		case css.WhitespaceToken, css.CommentToken:
+		case css.URLToken:
+			if raw, ok := unwrapURLToken(text); ok {
+				if local, ok := mapping[raw]; ok {
+					text = fmt.Sprintf(`url("%s")`, local)
+				}
+			}
+			prevAtImport = false
+		case css.StringToken:
+			if prevAtImport {
+				if local, ok := mapping[unwrapQuotes(text)]; ok {
+					text = fmt.Sprintf(`"%s"`, local)
+				}
+			}
+			prevAtImport = false
+		default:
+			prevAtImport = false
+		}
+		out.WriteString(text)
+	}
+	return out.String()
+}
+
+// unwrapURLToken extracts the URL out of a lexed CSS URLToken, e.g.
+// `url(foo.png)` or `url('foo.png')` -> `foo.png`.
+func unwrapURLToken(tok string) (string, bool) {
+	lower := strings.ToLower(tok)
+	if !strings.HasPrefix(lower, "url(") || !strings.HasSuffix(tok, ")") {
+		return "", false
+	}
+	inner := strings.TrimSpace(tok[4 : len(tok)-1])
+	inner = unwrapQuotes(inner)
+	if inner == "" {
+		return "", false
+	}
+	return inner, true
+}
+
+// unwrapQuotes strips a single matching pair of surrounding quotes, if any.
+func unwrapQuotes(s string) string {
+	if len(s) >= 2 {
+		if (s[0] == '"' && s[len(s)-1] == '"') || (s[0] == '\'' && s[len(s)-1] == '\'') {
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
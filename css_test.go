@@ -0,0 +1,124 @@
+package main
+
+import "testing"
+
+func TestExtractCSSRefs(t *testing.T) {
+	tests := []struct {
+		name string
+		css  string
+		want []string
+	}{
+		{
+			"plain url()",
+			`body { background: url(bg.png); }`,
+			[]string{"bg.png"},
+		},
+		{
+			"quoted url()",
+			`body { background: url("bg.png"); }`,
+			[]string{"bg.png"},
+		},
+		{
+			"single-quoted import",
+			`@import 'base.css'; body { color: red; }`,
+			[]string{"base.css"},
+		},
+		{
+			"import with url()",
+			`@import url("base.css");`,
+			[]string{"base.css"},
+		},
+		{
+			"data URI skipped",
+			`body { background: url(data:image/png;base64,aGVsbG8=); }`,
+			nil,
+		},
+		{
+			"multiple references",
+			`@import "a.css"; .x { background: url('b.png'); } .y { background: url(c.png); }`,
+			[]string{"a.css", "b.png", "c.png"},
+		},
+		{
+			"string token not after @import is ignored",
+			`.x::before { content: "not-a-url.png"; }`,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs := extractCSSRefs(tt.css)
+			var got []string
+			for _, r := range refs {
+				got = append(got, r.RawURL)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("extractCSSRefs(%q) = %v, want %v", tt.css, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("extractCSSRefs(%q)[%d] = %q, want %q", tt.css, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteCSS(t *testing.T) {
+	tests := []struct {
+		name    string
+		css     string
+		mapping map[string]string
+		want    string
+	}{
+		{
+			"rewrites plain url()",
+			`body { background: url(bg.png); }`,
+			map[string]string{"bg.png": "local/bg.png"},
+			`body { background: url("local/bg.png"); }`,
+		},
+		{
+			"rewrites @import string",
+			`@import "base.css";`,
+			map[string]string{"base.css": "local/base.css"},
+			`@import "local/base.css";`,
+		},
+		{
+			"leaves unmapped refs untouched",
+			`body { background: url(bg.png); }`,
+			map[string]string{},
+			`body { background: url(bg.png); }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteCSS(tt.css, tt.mapping); got != tt.want {
+				t.Errorf("rewriteCSS(%q) = %q, want %q", tt.css, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnwrapURLToken(t *testing.T) {
+	tests := []struct {
+		tok    string
+		want   string
+		wantOk bool
+	}{
+		{"url(foo.png)", "foo.png", true},
+		{`url("foo.png")`, "foo.png", true},
+		{"url('foo.png')", "foo.png", true},
+		{"url()", "", false},
+		{"not-a-url", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tok, func(t *testing.T) {
+			got, ok := unwrapURLToken(tt.tok)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("unwrapURLToken(%q) = (%q, %v), want (%q, %v)", tt.tok, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// AssetKind classifies what an Asset reference is used for, so the
+// downloader and rewriter can treat images, stylesheets, and page links
+// differently even though they're all just URLs found in the markup.
+type AssetKind int
+
+const (
+	AssetImage AssetKind = iota
+	AssetStylesheet
+	AssetScript
+	AssetIframe
+	AssetMedia
+	AssetLink
+	AssetSrcset
+)
+
+// Asset is a single URL reference found while parsing a page: which DOM
+// node and attribute it came from, so the rewriter can patch that exact
+// spot in place instead of doing a global string replace that could also
+// hit unrelated text elsewhere in the document.
+type Asset struct {
+	Kind   AssetKind
+	RawURL string
+	Attr   string
+	Node   *html.Node
+}
+
+// isDataURI reports whether rawURL is an inline data: URI, which should
+// never be queued for download or rewritten.
+func isDataURI(rawURL string) bool {
+	return strings.HasPrefix(strings.TrimSpace(rawURL), "data:")
+}
+
+// parsePage parses HTML content into a DOM tree and collects every
+// attribute-level asset reference in it: <img src>/srcset, <picture>/
+// <source> srcset, <link rel=stylesheet href>, <script src>, <iframe src>,
+// <video>/<audio> src, and <a href>. Inline style="" attributes and <style>
+// blocks are handled separately by rewriteInlineCSS, since their url(...)
+// references live inside a CSS blob rather than as a whole attribute value.
+func parsePage(content string) (*html.Node, []Asset, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing HTML: %v", err)
+	}
+
+	var assets []Asset
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			assets = append(assets, elementAssets(n)...)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return doc, assets, nil
+}
+
+func nodeAttr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// setAttr overwrites (or adds) an attribute on n in place.
+func setAttr(n *html.Node, name, val string) {
+	for i, a := range n.Attr {
+		if a.Key == name {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: name, Val: val})
+}
+
+func elementAssets(n *html.Node) []Asset {
+	var assets []Asset
+
+	addAttr := func(kind AssetKind, attrName string) {
+		if val, ok := nodeAttr(n, attrName); ok {
+			if v := strings.TrimSpace(val); v != "" && !isDataURI(v) {
+				assets = append(assets, Asset{Kind: kind, RawURL: v, Attr: attrName, Node: n})
+			}
+		}
+	}
+	addSrcset := func() {
+		if val, ok := nodeAttr(n, "srcset"); ok && strings.TrimSpace(val) != "" {
+			assets = append(assets, Asset{Kind: AssetSrcset, RawURL: val, Attr: "srcset", Node: n})
+		}
+	}
+
+	switch n.DataAtom {
+	case atom.Img:
+		addAttr(AssetImage, "src")
+		addSrcset()
+	case atom.Source:
+		addAttr(AssetMedia, "src")
+		addSrcset()
+	case atom.Link:
+		if rel, ok := nodeAttr(n, "rel"); ok && strings.EqualFold(strings.TrimSpace(rel), "stylesheet") {
+			addAttr(AssetStylesheet, "href")
+		}
+	case atom.Script:
+		addAttr(AssetScript, "src")
+	case atom.Iframe:
+		addAttr(AssetIframe, "src")
+	case atom.Video, atom.Audio:
+		addAttr(AssetMedia, "src")
+	case atom.A:
+		addAttr(AssetLink, "href")
+	}
+
+	return assets
+}
+
+// resolveURL resolves rawURL against base, skipping anything that isn't
+// http(s) (mailto:, javascript:, tel:, etc).
+func resolveURL(base *url.URL, rawURL string) (*url.URL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.IsAbs() {
+		parsed = base.ResolveReference(parsed)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme in %s", rawURL)
+	}
+	return parsed, nil
+}
+
+// renderPage serializes the (possibly rewritten) DOM tree back to HTML.
+func renderPage(doc *html.Node) (string, error) {
+	var buf strings.Builder
+	if err := html.Render(&buf, doc); err != nil {
+		return "", fmt.Errorf("error rendering HTML: %v", err)
+	}
+	return buf.String(), nil
+}
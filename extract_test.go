@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func findAsset(assets []Asset, kind AssetKind, rawURL string) bool {
+	for _, a := range assets {
+		if a.Kind == kind && a.RawURL == rawURL {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParsePageExtractsAssets(t *testing.T) {
+	content := `<html><head>
+<link rel="stylesheet" href="/style.css">
+<link rel="icon" href="/favicon.ico">
+</head><body>
+<img src="/a.png" srcset="/a-1x.png 1x, /a-2x.png 2x">
+<picture><source srcset="/b.webp 1x, /b-2x.webp 2x"><img src="/b.png"></picture>
+<script src="/app.js"></script>
+<iframe src="/frame.html"></iframe>
+<video src="/v.mp4"></video>
+<a href="/page2.html">next</a>
+<img src="data:image/png;base64,aGVsbG8=">
+</body></html>`
+
+	_, assets, err := parsePage(content)
+	if err != nil {
+		t.Fatalf("parsePage: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		kind AssetKind
+		url  string
+		want bool
+	}{
+		{"stylesheet link", AssetStylesheet, "/style.css", true},
+		{"non-stylesheet link not collected", AssetLink, "/favicon.ico", false},
+		{"img src", AssetImage, "/a.png", true},
+		{"img srcset", AssetSrcset, "/a-1x.png 1x, /a-2x.png 2x", true},
+		{"picture source srcset", AssetSrcset, "/b.webp 1x, /b-2x.webp 2x", true},
+		{"picture fallback img", AssetImage, "/b.png", true},
+		{"script src", AssetScript, "/app.js", true},
+		{"iframe src", AssetIframe, "/frame.html", true},
+		{"video src", AssetMedia, "/v.mp4", true},
+		{"page link", AssetLink, "/page2.html", true},
+		{"data URI img skipped", AssetImage, "data:image/png;base64,aGVsbG8=", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findAsset(assets, tt.kind, tt.url); got != tt.want {
+				t.Errorf("findAsset(%v, %q) = %v, want %v", tt.kind, tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePageIgnoresNonStylesheetLinkRel(t *testing.T) {
+	content := `<link rel="alternate" href="/feed.xml">`
+	_, assets, err := parsePage(content)
+	if err != nil {
+		t.Fatalf("parsePage: %v", err)
+	}
+	for _, a := range assets {
+		if a.RawURL == "/feed.xml" {
+			t.Errorf("expected rel=alternate link not to be collected as an asset, got %+v", a)
+		}
+	}
+}
+
+func TestRenderPageRoundTrips(t *testing.T) {
+	content := `<html><head></head><body><img src="/a.png"/></body></html>`
+	doc, _, err := parsePage(content)
+	if err != nil {
+		t.Fatalf("parsePage: %v", err)
+	}
+	rendered, err := renderPage(doc)
+	if err != nil {
+		t.Fatalf("renderPage: %v", err)
+	}
+	if !strings.Contains(rendered, `src="/a.png"`) {
+		t.Errorf("rendered output missing expected attribute, got: %s", rendered)
+	}
+}
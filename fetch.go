@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUserAgent  = "wget11/1.0"
+	defaultAccept     = "text/html,application/xhtml+xml,application/xml;q=0.9,image/*,*/*;q=0.8"
+	defaultMaxRetries = 3
+	defaultCrawlDelay = 500 * time.Millisecond
+)
+
+// Fetcher wraps http.Client with the politeness and reliability features a
+// crawler needs that a bare http.Get doesn't give you: robots.txt
+// compliance, a per-host rate limit (seeded from robots.txt's Crawl-delay
+// when present), configurable headers, and retries with exponential
+// backoff on transient errors. Non-2xx responses are returned as errors
+// rather than handed back as a body to save to disk.
+type Fetcher struct {
+	client       *http.Client
+	userAgent    string
+	accept       string
+	ignoreRobots bool
+	maxRetries   int
+
+	robotsMu sync.Mutex
+	robots   map[string]*robotsRules
+
+	limitersMu sync.Mutex
+	limiters   map[string]*rateLimiter
+}
+
+// NewFetcher builds a Fetcher with the given per-request timeout. An empty
+// userAgent falls back to defaultUserAgent.
+func NewFetcher(timeout time.Duration, userAgent string, ignoreRobots bool) *Fetcher {
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	return &Fetcher{
+		client:       &http.Client{Timeout: timeout},
+		userAgent:    userAgent,
+		accept:       defaultAccept,
+		ignoreRobots: ignoreRobots,
+		maxRetries:   defaultMaxRetries,
+		robots:       make(map[string]*robotsRules),
+		limiters:     make(map[string]*rateLimiter),
+	}
+}
+
+// httpFetcher is the Fetcher used by downloadFile and fetchAndSavePage.
+// main reconfigures it from flags before any fetching starts.
+var httpFetcher = NewFetcher(30*time.Second, "", false)
+
+// reporter is how every fetch (and everything else) surfaces progress and
+// errors. main reconfigures it from flags before any fetching starts.
+var reporter Reporter = newDefaultReporter()
+
+func newDefaultReporter() Reporter {
+	r, _ := NewReporter(false, VerboseNone, "")
+	return r
+}
+
+// FetchResult is the outcome of a conditional fetch: either a fresh body
+// plus the validators to remember for next time, or NotModified if the
+// previously cached copy is still good.
+type FetchResult struct {
+	Body         []byte
+	NotModified  bool
+	ETag         string
+	LastModified string
+}
+
+// Get fetches urlStr unconditionally, honoring robots.txt and the per-host
+// rate limit, and retrying transient network/5xx errors with exponential
+// backoff.
+func (f *Fetcher) Get(urlStr string) ([]byte, error) {
+	return f.GetMeta(urlStr, FetchMeta{})
+}
+
+// GetMeta behaves like Get, but attributes the reported fetch event to the
+// given crawl context (source page and depth).
+func (f *Fetcher) GetMeta(urlStr string, meta FetchMeta) ([]byte, error) {
+	result, err := f.getConditional(urlStr, "", "", meta)
+	if err != nil {
+		return nil, err
+	}
+	return result.Body, nil
+}
+
+// GetConditional behaves like Get, but sends If-None-Match/If-Modified-Since
+// when etag/lastModified are non-empty (as recorded from a prior fetch) and
+// reports NotModified instead of a body when the server replies 304.
+func (f *Fetcher) GetConditional(urlStr, etag, lastModified string) (*FetchResult, error) {
+	return f.getConditional(urlStr, etag, lastModified, FetchMeta{})
+}
+
+// GetConditionalMeta behaves like GetConditional, but attributes the
+// reported fetch event to the given crawl context (source page and depth).
+func (f *Fetcher) GetConditionalMeta(urlStr, etag, lastModified string, meta FetchMeta) (*FetchResult, error) {
+	return f.getConditional(urlStr, etag, lastModified, meta)
+}
+
+func (f *Fetcher) getConditional(urlStr, etag, lastModified string, meta FetchMeta) (*FetchResult, error) {
+	started := time.Now()
+	result, status, err := f.getConditionalOnce(urlStr, etag, lastModified)
+
+	bytes := 0
+	if result != nil {
+		bytes = len(result.Body)
+	}
+	reporter.Fetched(FetchEvent{
+		URL:        urlStr,
+		Status:     status,
+		Bytes:      bytes,
+		Elapsed:    time.Since(started),
+		SourcePage: meta.SourcePage,
+		Depth:      meta.Depth,
+		Err:        err,
+	})
+	return result, err
+}
+
+// getConditionalOnce runs the robots/rate-limit/retry pipeline for a single
+// request, also returning the final HTTP status code reached (0 if the
+// request never got a response, e.g. disallowed by robots.txt or a network
+// error on every attempt).
+func (f *Fetcher) getConditionalOnce(urlStr, etag, lastModified string) (result *FetchResult, status int, err error) {
+	parsed, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error parsing URL %s: %v", urlStr, err)
+	}
+
+	if !f.ignoreRobots && !f.robotsAllowed(parsed) {
+		return nil, 0, fmt.Errorf("disallowed by robots.txt: %s", urlStr)
+	}
+	f.limiterFor(parsed).Wait()
+
+	var lastErr error
+	var lastStatus int
+	for attempt := 0; attempt <= f.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff(attempt))
+		}
+
+		var result2 *FetchResult
+		var retryable bool
+		result2, lastStatus, retryable, err = f.attempt(urlStr, etag, lastModified)
+		if err == nil {
+			return result2, lastStatus, nil
+		}
+		lastErr = err
+		if !retryable {
+			return nil, lastStatus, lastErr
+		}
+	}
+	return nil, lastStatus, lastErr
+}
+
+// attempt makes a single request, reporting the HTTP status code reached
+// (0 if none) and whether a failure is worth retrying (network errors and
+// 5xx) versus terminal (4xx, bad URL).
+func (f *Fetcher) attempt(urlStr, etag, lastModified string) (result *FetchResult, status int, retryable bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("error building request for %s: %v", urlStr, err)
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", f.accept)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, 0, true, fmt.Errorf("error downloading %s: %v", urlStr, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		return &FetchResult{NotModified: true, ETag: etag, LastModified: lastModified}, resp.StatusCode, false, nil
+	}
+	if resp.StatusCode >= 500 {
+		io.Copy(io.Discard, resp.Body)
+		return nil, resp.StatusCode, true, fmt.Errorf("server error %d fetching %s", resp.StatusCode, urlStr)
+	}
+	if resp.StatusCode >= 400 {
+		io.Copy(io.Discard, resp.Body)
+		return nil, resp.StatusCode, false, fmt.Errorf("%d response fetching %s", resp.StatusCode, urlStr)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, true, fmt.Errorf("error reading response body for %s: %v", urlStr, err)
+	}
+	return &FetchResult{
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, resp.StatusCode, false, nil
+}
+
+func backoff(attempt int) time.Duration {
+	return time.Duration(math.Pow(2, float64(attempt-1))*100) * time.Millisecond
+}
+
+func (f *Fetcher) limiterFor(u *url.URL) *rateLimiter {
+	host := u.Host
+
+	f.limitersMu.Lock()
+	defer f.limitersMu.Unlock()
+	if rl, ok := f.limiters[host]; ok {
+		return rl
+	}
+
+	delay := defaultCrawlDelay
+	if !f.ignoreRobots {
+		if rules := f.robotsForHost(u); rules.crawlDelay > 0 {
+			delay = rules.crawlDelay
+		}
+	}
+	rl := &rateLimiter{interval: delay}
+	f.limiters[host] = rl
+	return rl
+}
+
+func (f *Fetcher) robotsAllowed(u *url.URL) bool {
+	return f.robotsForHost(u).allowed(u.Path)
+}
+
+// robotsForHost returns the cached robots.txt rules for u's host, fetching
+// and parsing them on first use.
+func (f *Fetcher) robotsForHost(u *url.URL) *robotsRules {
+	host := u.Host
+
+	f.robotsMu.Lock()
+	if rules, ok := f.robots[host]; ok {
+		f.robotsMu.Unlock()
+		return rules
+	}
+	f.robotsMu.Unlock()
+
+	rules := fetchRobots(f.client, u.Scheme, host, f.userAgent)
+
+	f.robotsMu.Lock()
+	f.robots[host] = rules
+	f.robotsMu.Unlock()
+	return rules
+}
+
+// rateLimiter enforces a minimum interval between successive Wait calls,
+// blocking the caller as needed.
+type rateLimiter struct {
+	mu       sync.Mutex
+	next     time.Time
+	interval time.Duration
+}
+
+func (r *rateLimiter) Wait() {
+	r.mu.Lock()
+	for {
+		now := time.Now()
+		if !now.Before(r.next) {
+			r.next = now.Add(r.interval)
+			r.mu.Unlock()
+			return
+		}
+		wait := r.next.Sub(now)
+		r.mu.Unlock()
+		time.Sleep(wait)
+		r.mu.Lock()
+		// Another waiter may have claimed the slot (and pushed r.next
+		// further out) while we were asleep, so loop and re-check
+		// rather than assuming we're clear to go.
+	}
+}
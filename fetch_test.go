@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRateLimiterSerializesConcurrentWaiters checks that concurrent Wait
+// calls are spaced out by interval rather than all firing together: with N
+// waiters and an interval of d, the last one to proceed must do so no
+// earlier than roughly (N-1)*d after the first.
+func TestRateLimiterSerializesConcurrentWaiters(t *testing.T) {
+	const waiters = 5
+	interval := 20 * time.Millisecond
+	rl := &rateLimiter{interval: interval}
+
+	var mu sync.Mutex
+	var times []time.Time
+	var wg sync.WaitGroup
+
+	wg.Add(waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			defer wg.Done()
+			rl.Wait()
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(times) != waiters {
+		t.Fatalf("got %d completions, want %d", len(times), waiters)
+	}
+
+	// Sort isn't needed for the span check: regardless of arrival order,
+	// the spread between the earliest and latest completion must be at
+	// least (waiters-1)*interval if they were properly serialized.
+	earliest, latest := times[0], times[0]
+	for _, ts := range times[1:] {
+		if ts.Before(earliest) {
+			earliest = ts
+		}
+		if ts.After(latest) {
+			latest = ts
+		}
+	}
+
+	minSpan := time.Duration(waiters-1) * interval
+	if span := latest.Sub(earliest); span < minSpan {
+		t.Errorf("waiters completed within %v of each other, want at least %v (not serialized)", span, minSpan)
+	}
+}
@@ -3,83 +3,19 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"time"
 )
 
-func extractImages(htmlContent string) ([]string, error) {
-	var allImageURLs []string
-
-	// Extract background-image URLs from <style> tags
-	styleRegex := regexp.MustCompile(`(?s)<style.*?>.*?</style>`)
-	styleMatches := styleRegex.FindAllString(htmlContent, -1)
-	for _, styleMatch := range styleMatches {
-		bgImageRegex := regexp.MustCompile(`background-image\s*:\s*([^;]+)`)
-		bgImageMatches := bgImageRegex.FindAllStringSubmatch(styleMatch, -1)
-
-		urlRegex := regexp.MustCompile(`url\(['"]?([^'")]+)['"]?\)`)
-		for _, bgImageMatch := range bgImageMatches {
-			if len(bgImageMatch) < 2 {
-				continue
-			}
-			urlMatches := urlRegex.FindAllStringSubmatch(bgImageMatch[1], -1)
-			for _, match := range urlMatches {
-				if len(match) > 1 {
-					url := strings.TrimSpace(match[1])
-					if url != "" {
-						allImageURLs = append(allImageURLs, url)
-					}
-				}
-			}
-		}
-	}
-
-	// Extract <img> src attributes
-	imgRegex := regexp.MustCompile(`<img[^>]+src=['"]?([^'"\s>]+)['"]?`)
-	imgMatches := imgRegex.FindAllStringSubmatch(htmlContent, -1)
-	for _, match := range imgMatches {
-		if len(match) > 1 {
-			url := strings.TrimSpace(match[1])
-			if url != "" {
-				allImageURLs = append(allImageURLs, url)
-			}
-		}
-	}
-
-	if len(allImageURLs) == 0 {
-		return nil, nil
-	}
-	return allImageURLs, nil
-}
-
-func extractStylesheets(htmlContent string) ([]string, error) {
-	// More flexible regex for <link> tags
-	linkRegex := regexp.MustCompile(`<link[^>]+href=['"]?([^'"\s>]+)['"]?[^>]*rel=['"]?stylesheet['"]?`)
-	linkMatches := linkRegex.FindAllStringSubmatch(htmlContent, -1)
-	var stylesheets []string
-	for _, match := range linkMatches {
-		if len(match) > 1 {
-			url := strings.TrimSpace(match[1])
-			if url != "" {
-				stylesheets = append(stylesheets, url)
-			}
-		}
-	}
-
-	// Debug: Print if no stylesheets found
-	if len(stylesheets) == 0 {
-		fmt.Println("No stylesheets found in HTML")
-	}
-
-	return stylesheets, nil
-}
-
-func downloadFile(urlStr, targetPath string, baseURL string) error {
+// downloadFile fetches urlStr to targetPath, making a conditional request
+// (If-None-Match/If-Modified-Since) against whatever validators pathMapper
+// recorded for it on a previous run. If the server reports the cached copy
+// is still fresh and it's actually present on disk, the fetch is skipped
+// entirely.
+func downloadFile(urlStr, targetPath string, baseURL string, meta FetchMeta) error {
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
 		return fmt.Errorf("error parsing URL %s: %v", urlStr, err)
@@ -98,165 +34,102 @@ func downloadFile(urlStr, targetPath string, baseURL string) error {
 		return fmt.Errorf("error creating directory for %s: %v", targetPath, err)
 	}
 
-	resp, err := http.Get(parsedURL.String())
-	if err != nil {
-		return fmt.Errorf("error downloading %s: %v", parsedURL.String(), err)
-	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(targetPath)
-	if err != nil {
-		return fmt.Errorf("error creating file %s: %v", targetPath, err)
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
-}
-
-func updateImageURLs(content string, oldURLs, newURLs []string) string {
-	for i, oldURL := range oldURLs {
-		if i < len(newURLs) {
-			bgPattern := fmt.Sprintf(`url\(['"]?%s['"]?\)`, regexp.QuoteMeta(oldURL))
-			newBgPattern := fmt.Sprintf(`url("%s")`, newURLs[i])
-			content = regexp.MustCompile(bgPattern).ReplaceAllString(content, newBgPattern)
-
-			imgPattern := fmt.Sprintf(`src=['"]?%s['"]?`, regexp.QuoteMeta(oldURL))
-			newImgPattern := fmt.Sprintf(`src="%s"`, newURLs[i])
-			content = regexp.MustCompile(imgPattern).ReplaceAllString(content, newImgPattern)
-		}
-	}
-	return content
-}
-
-func updateStylesheetURLs(content string, oldURLs, newURLs []string) string {
-	for i, oldURL := range oldURLs {
-		if i < len(newURLs) {
-			linkPattern := fmt.Sprintf(`href=['"]?%s['"]?`, regexp.QuoteMeta(oldURL))
-			newLinkPattern := fmt.Sprintf(`href="%s"`, newURLs[i])
-			content = regexp.MustCompile(linkPattern).ReplaceAllString(content, newLinkPattern)
-		}
-	}
-	return content
-}
-
-func processHTMLContent(content string, filePath string, baseURL string, targetDir string) error {
-	// Process images
-	images, err := extractImages(content)
-	if err != nil {
-		return fmt.Errorf("error extracting images from %s: %v", filePath, err)
-	}
-
-	var newImagePaths []string
-	if len(images) > 0 {
-		fmt.Printf("\nFile: %s\n", filePath)
-		fmt.Println("Found images:")
-		for i, img := range images {
-			fmt.Printf("%d: %s\n", i+1, img)
-			
-			targetPath := filepath.Join(targetDir, strings.TrimLeft(img, "/"))
-			newImagePaths = append(newImagePaths, strings.TrimLeft(img, "/"))
-			
-			err := downloadFile(img, targetPath, baseURL)
-			if err != nil {
-				fmt.Printf("Failed to download %s: %v\n", img, err)
-			} else {
-				fmt.Printf("Downloaded %s to %s\n", img, targetPath)
-			}
-		}
+	etag, lastModified := pathMapper.Conditions(parsedURL)
+	if _, statErr := os.Stat(targetPath); statErr != nil {
+		etag, lastModified = "", ""
 	}
 
-	// Process stylesheets
-	stylesheets, err := extractStylesheets(content)
+	result, err := httpFetcher.GetConditionalMeta(parsedURL.String(), etag, lastModified, meta)
 	if err != nil {
-		return fmt.Errorf("error extracting stylesheets from %s: %v", filePath, err)
+		return err
 	}
-
-	var newStylesheetPaths []string
-	if len(stylesheets) > 0 {
-		cssDir := filepath.Join(targetDir, "css")
-		fmt.Println("Found stylesheets:")
-		for i, css := range stylesheets {
-			fmt.Printf("%d: %s\n", i+1, css)
-			
-			filename := filepath.Base(css)
-			targetPath := filepath.Join(cssDir, filename)
-			newStylesheetPaths = append(newStylesheetPaths, filepath.Join("css", filename))
-			
-			err := downloadFile(css, targetPath, baseURL)
-			if err != nil {
-				fmt.Printf("Failed to download %s: %v\n", css, err)
-			} else {
-				fmt.Printf("Downloaded %s to %s\n", css, targetPath)
-			}
-		}
+	if result.NotModified {
+		return nil
 	}
 
-	// Update HTML content with new paths
-	updatedContent := content
-	if len(images) > 0 {
-		updatedContent = updateImageURLs(updatedContent, images, newImagePaths)
+	if err := os.WriteFile(targetPath, result.Body, 0644); err != nil {
+		return err
 	}
-	if len(stylesheets) > 0 {
-		updatedContent = updateStylesheetURLs(updatedContent, stylesheets, newStylesheetPaths)
-	}
-
-	// Write updated content back to file
-	err = os.WriteFile(filePath, []byte(updatedContent), 0644)
-	if err != nil {
-		return fmt.Errorf("error updating file %s: %v", filePath, err)
-	}
-	
+	pathMapper.Record(parsedURL, result.ETag, result.LastModified)
 	return nil
 }
 
-func downloadAndSave(urlStr, baseDir string, convertLinks bool) error {
+// pathMapper assigns every downloaded asset its stable, content-addressable
+// local path and persists those assignments (plus cache validators) across
+// runs. main loads it from the mirror's base directory before any fetching
+// starts and saves it once the run finishes.
+var pathMapper *PathMapper
+
+// fetchAndSavePage downloads a single page to its mirrored path under
+// baseDir (derived from the URL via pagePath) and returns the file it wrote,
+// the page's mirror root directory, and the raw body for further
+// processing. meta attributes the fetch to the crawl context (the page
+// that linked here, and how deep the crawl is) for progress reporting.
+func fetchAndSavePage(urlStr, baseDir string, convertLinks bool, meta FetchMeta) (outputFile, targetDir string, body string, err error) {
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		return fmt.Errorf("invalid URL %s: %v", urlStr, err)
+		return "", "", "", fmt.Errorf("invalid URL %s: %v", urlStr, err)
 	}
-	targetDir := filepath.Join(baseDir, parsedURL.Hostname())
-	err = os.MkdirAll(targetDir, 0755)
+	targetDir = filepath.Join(baseDir, parsedURL.Hostname())
+	outputFile = filepath.Join(baseDir, pagePath(parsedURL))
+	err = os.MkdirAll(filepath.Dir(outputFile), 0755)
 	if err != nil {
-		return fmt.Errorf("error creating directory %s: %v", targetDir, err)
+		return "", "", "", fmt.Errorf("error creating directory %s: %v", filepath.Dir(outputFile), err)
 	}
 
-	resp, err := http.Get(urlStr)
+	bodyBytes, err := httpFetcher.GetMeta(urlStr, meta)
 	if err != nil {
-		return fmt.Errorf("error downloading %s: %v", urlStr, err)
+		return "", "", "", err
 	}
-	defer resp.Body.Close()
+	body = string(bodyBytes)
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("error reading response body: %v", err)
+	if convertLinks {
+		body = strings.ReplaceAll(body, urlStr, "/")
 	}
 
-	outputFile := filepath.Join(targetDir, "index.html")
-	err = os.WriteFile(outputFile, body, 0644)
+	err = os.WriteFile(outputFile, []byte(body), 0644)
 	if err != nil {
-		return fmt.Errorf("error writing file %s: %v", outputFile, err)
-	}
-
-	if convertLinks {
-		content := string(body)
-		content = strings.ReplaceAll(content, urlStr, "/")
-		err = os.WriteFile(outputFile, []byte(content), 0644)
-		if err != nil {
-			return fmt.Errorf("error writing converted file %s: %v", outputFile, err)
-		}
+		return "", "", "", fmt.Errorf("error writing file %s: %v", outputFile, err)
 	}
 
-	return processHTMLContent(string(body), outputFile, urlStr, targetDir)
+	return outputFile, targetDir, body, nil
 }
 
 func main() {
 	mirror := flag.Bool("mirror", false, "Mirror the website")
 	convertLinks := flag.Bool("convert-links", false, "Convert absolute links to relative")
 	dirPath := flag.String("dir", "", "Directory path containing HTML files")
+	workers := flag.Int("workers", 4, "Number of concurrent fetch workers for --mirror")
+	depth := flag.Int("depth", 0, "How many link-hops to follow from the seed URL (0 = single page)")
+	outer := flag.Bool("outer", false, "Follow links to other hosts too (default: stay on the seed host)")
+	allowDomains := flag.String("allow-domains", "", "Comma-separated extra hosts to follow when -outer=false")
+	timeout := flag.Duration("T", 30*time.Second, "Per-request network timeout")
+	userAgent := flag.String("user-agent", "", "User-Agent header to send (default: "+defaultUserAgent+")")
+	ignoreRobots := flag.Bool("ignore-robots", false, "Don't consult robots.txt before fetching")
+	archive := flag.String("archive", "", "Save the seed page as a single self-contained archive file instead of a mirror tree: mhtml or single-html")
+	quiet := flag.Bool("s", false, "Quiet: suppress all progress and error output")
+	verbose := flag.Bool("v", false, "Verbose: log every asset downloaded")
+	veryVerbose := flag.Bool("vv", false, "Very verbose: also log internal rewrite steps")
+	logJSON := flag.String("log-json", "", "Write a JSONL event (status, bytes, elapsed, source page, depth) per fetched URL to this file")
 
 	flag.Parse()
 
+	httpFetcher = NewFetcher(*timeout, *userAgent, *ignoreRobots)
+
+	verbosity := VerboseNone
+	if *veryVerbose {
+		verbosity = VerboseVV
+	} else if *verbose {
+		verbosity = VerboseV
+	}
+	rep, err := NewReporter(*quiet, verbosity, *logJSON)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	reporter = rep
+	defer reporter.Close()
+
 	args := flag.Args()
 	if len(args) > 0 {
 		parsedURL, err := url.Parse(args[0])
@@ -267,11 +140,41 @@ func main() {
 				os.Exit(1)
 			}
 
-			err := downloadAndSave(args[0], ".", *convertLinks)
+			if *archive != "" {
+				mode, err := ParseArchiveMode(*archive)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				outputFile, err := archivePage(args[0], mode)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Saved archive to %s\n", outputFile)
+				return
+			}
+
+			var allow []string
+			if *allowDomains != "" {
+				allow = strings.Split(*allowDomains, ",")
+			}
+
+			pathMapper, err = LoadPathMapper(".")
 			if err != nil {
 				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
+
+			crawler := NewCrawler(".", *workers, *depth, *outer, allow, *convertLinks)
+			runErr := crawler.Run(args[0])
+			if err := pathMapper.Save(); err != nil {
+				fmt.Printf("Error saving manifest: %v\n", err)
+			}
+			if runErr != nil {
+				fmt.Printf("Error: %v\n", runErr)
+				os.Exit(1)
+			}
 			return
 		}
 	}
@@ -290,11 +193,20 @@ func main() {
 		os.Exit(1)
 	}
 
-	err := scanDirectory(*dirPath, "file://"+*dirPath)
+	pathMapper, err = LoadPathMapper(*dirPath)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
+
+	scanErr := scanDirectory(*dirPath, "file://"+*dirPath)
+	if err := pathMapper.Save(); err != nil {
+		fmt.Printf("Error saving manifest: %v\n", err)
+	}
+	if scanErr != nil {
+		fmt.Printf("Error: %v\n", scanErr)
+		os.Exit(1)
+	}
 }
 
 func scanDirectory(dirPath string, baseURL string) error {
@@ -309,6 +221,7 @@ func scanDirectory(dirPath string, baseURL string) error {
 		if err != nil {
 			return fmt.Errorf("error reading file %s: %v", path, err)
 		}
-		return processHTMLContent(string(content), path, baseURL, dirPath)
+		_, err = processHTMLContent(string(content), path, baseURL, dirPath, FetchMeta{}, nil)
+		return err
 	})
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// manifestFileName is the name of the manifest PathMapper persists under a
+// mirror's base directory, recording the URL -> local path assignments and
+// cache validators from the last run so a re-run can skip unchanged assets.
+const manifestFileName = ".wget-manifest.json"
+
+// manifestEntry is one URL's record in the persisted manifest.
+type manifestEntry struct {
+	LocalPath    string `json:"local_path"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// PathMapper assigns every asset URL a stable local mirror path of the form
+// <host>/<path>?<hashed-query>, resolving collisions (distinct URLs that
+// would otherwise land on the same path) with a short content-hash suffix.
+// Assignments and cache validators are persisted to manifestFileName so
+// subsequent runs reuse the same paths and can skip re-fetching unchanged
+// assets.
+type PathMapper struct {
+	manifestPath string
+
+	mu      sync.Mutex
+	entries map[string]*manifestEntry // URL -> entry
+	taken   map[string]string         // local path -> URL that claimed it
+}
+
+// LoadPathMapper reads the manifest under baseDir, if one exists, and
+// returns a PathMapper ready to assign and persist paths there. A missing
+// manifest is not an error; it just starts empty.
+func LoadPathMapper(baseDir string) (*PathMapper, error) {
+	m := &PathMapper{
+		manifestPath: filepath.Join(baseDir, manifestFileName),
+		entries:      make(map[string]*manifestEntry),
+		taken:        make(map[string]string),
+	}
+
+	body, err := os.ReadFile(m.manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("error reading manifest %s: %v", m.manifestPath, err)
+	}
+
+	if err := json.Unmarshal(body, &m.entries); err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %v", m.manifestPath, err)
+	}
+	for u, entry := range m.entries {
+		m.taken[entry.LocalPath] = u
+	}
+	return m, nil
+}
+
+// Save writes the current URL -> local path assignments and cache
+// validators back to the manifest file.
+func (m *PathMapper) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	body, err := json.MarshalIndent(m.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %v", err)
+	}
+	if err := os.WriteFile(m.manifestPath, body, 0644); err != nil {
+		return fmt.Errorf("error writing manifest %s: %v", m.manifestPath, err)
+	}
+	return nil
+}
+
+// LocalPath returns the mirror-relative local path to use for u, assigning
+// and remembering one (with a short hash suffix on collision) the first
+// time u is seen.
+func (m *PathMapper) LocalPath(u *url.URL) string {
+	key := u.String()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[key]; ok {
+		return entry.LocalPath
+	}
+
+	local := candidatePath(u)
+	if owner, ok := m.taken[local]; ok && owner != key {
+		local = local + "-" + shortHash(key)
+	}
+
+	m.entries[key] = &manifestEntry{LocalPath: local}
+	m.taken[local] = key
+	return local
+}
+
+// Conditions returns the ETag/Last-Modified validators recorded for u on a
+// previous run, so the caller can make a conditional request.
+func (m *PathMapper) Conditions(u *url.URL) (etag, lastModified string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[u.String()]
+	if !ok {
+		return "", ""
+	}
+	return entry.ETag, entry.LastModified
+}
+
+// Record saves the ETag/Last-Modified validators from a successful fetch of
+// u, for use by a future Conditions call.
+func (m *PathMapper) Record(u *url.URL, etag, lastModified string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[u.String()]
+	if !ok {
+		// LocalPath should always be called before Record; nothing to
+		// attach the validators to.
+		return
+	}
+	entry.ETag = etag
+	entry.LastModified = lastModified
+}
+
+// candidatePath builds the natural local path for u: its host, then its
+// URL path with the leading slash trimmed, with a short hash of the query
+// string appended to the filename when one is present.
+func candidatePath(u *url.URL) string {
+	p := strings.TrimLeft(u.Path, "/")
+	if p == "" {
+		p = "index"
+	}
+	return filepath.ToSlash(filepath.Join(u.Hostname(), withQueryHash(p, u.RawQuery)))
+}
+
+// withQueryHash appends a short hash of query to p's filename (before its
+// extension) when query is non-empty, so that URLs differing only by query
+// string don't collide on the same local path. Used by both candidatePath
+// (assets) and pagePath (pages) for the same reason.
+func withQueryHash(p, query string) string {
+	if query == "" {
+		return p
+	}
+	ext := filepath.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	return base + "-" + shortHash(query) + ext
+}
+
+// shortHash returns the first 8 hex characters of the SHA-1 hash of s, used
+// to keep generated path suffixes short but collision-resistant.
+func shortHash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])[:8]
+}
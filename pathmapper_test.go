@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", raw, err)
+	}
+	return u
+}
+
+func TestPathMapperLocalPathStable(t *testing.T) {
+	m, err := LoadPathMapper(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadPathMapper: %v", err)
+	}
+	u := mustParseURL(t, "https://example.com/style.css")
+
+	first := m.LocalPath(u)
+	second := m.LocalPath(u)
+	if first != second {
+		t.Errorf("LocalPath not stable across calls: %q then %q", first, second)
+	}
+	if want := filepath.ToSlash(filepath.Join("example.com", "style.css")); first != want {
+		t.Errorf("LocalPath = %q, want %q", first, want)
+	}
+}
+
+func TestPathMapperDistinctQueriesDontCollide(t *testing.T) {
+	m, err := LoadPathMapper(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadPathMapper: %v", err)
+	}
+	a := m.LocalPath(mustParseURL(t, "https://example.com/posts?id=1"))
+	b := m.LocalPath(mustParseURL(t, "https://example.com/posts?id=2"))
+
+	if a == b {
+		t.Errorf("distinct query strings collided on the same local path: %q", a)
+	}
+}
+
+func TestPathMapperCollisionSuffix(t *testing.T) {
+	m, err := LoadPathMapper(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadPathMapper: %v", err)
+	}
+
+	// Two different hosts whose candidatePath would otherwise be forced
+	// to collide: simulate by claiming the path out from under the
+	// second URL via m.taken directly isn't possible from outside the
+	// package, so instead rely on candidatePath's own query-hash path
+	// and confirm a manual collision resolves with a distinct suffix.
+	first := m.LocalPath(mustParseURL(t, "https://example.com/a.png"))
+	m.taken["example.com/b.png"] = "https://example.com/a.png" // pretend a.png's path was "b.png"
+
+	second := m.LocalPath(mustParseURL(t, "https://example.com/b.png"))
+	if second == first {
+		t.Fatalf("expected a distinct path when the candidate path is already taken, got %q", second)
+	}
+	if second == "example.com/b.png" {
+		t.Errorf("expected collision suffix to be appended, got unsuffixed %q", second)
+	}
+}
+
+func TestPathMapperConditionsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	m, err := LoadPathMapper(dir)
+	if err != nil {
+		t.Fatalf("LoadPathMapper: %v", err)
+	}
+	u := mustParseURL(t, "https://example.com/a.png")
+
+	if etag, lastMod := m.Conditions(u); etag != "" || lastMod != "" {
+		t.Fatalf("expected no validators before LocalPath/Record, got (%q, %q)", etag, lastMod)
+	}
+
+	m.LocalPath(u)
+	m.Record(u, `"abc123"`, "Mon, 02 Jan 2006 15:04:05 GMT")
+
+	etag, lastMod := m.Conditions(u)
+	if etag != `"abc123"` || lastMod != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("Conditions = (%q, %q), want recorded validators", etag, lastMod)
+	}
+
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	reloaded, err := LoadPathMapper(dir)
+	if err != nil {
+		t.Fatalf("LoadPathMapper (reload): %v", err)
+	}
+	etag, lastMod = reloaded.Conditions(u)
+	if etag != `"abc123"` || lastMod != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("after reload, Conditions = (%q, %q), want recorded validators", etag, lastMod)
+	}
+}
+
+func TestShortHashDeterministicAndDistinct(t *testing.T) {
+	if shortHash("a") != shortHash("a") {
+		t.Error("shortHash not deterministic")
+	}
+	if shortHash("a") == shortHash("b") {
+		t.Error("shortHash collided on distinct inputs")
+	}
+	if len(shortHash("anything")) != 8 {
+		t.Errorf("shortHash length = %d, want 8", len(shortHash("anything")))
+	}
+}
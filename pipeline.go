@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// processHTMLContent parses content as HTML, downloads every image,
+// stylesheet, script, iframe and media asset it references (rewriting the
+// page in place to point at the local copies), and returns the absolute
+// URLs of every page link it found (<a href>) so a caller can recurse into
+// them. meta attributes every asset fetch to the crawl context (source page
+// and depth) this content was found at, for progress reporting. linkAllowed
+// decides whether a discovered <a href> is actually going to be mirrored
+// (and so can be rewritten to point at a local path); links it rejects are
+// left pointing at their original absolute URL, matching wget -k behavior
+// for hosts the crawl won't follow. A nil linkAllowed allows every link.
+func processHTMLContent(content string, filePath string, baseURL string, targetDir string, meta FetchMeta, linkAllowed func(host string) bool) ([]string, error) {
+	parsedBase, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing base URL %s: %v", baseURL, err)
+	}
+	isWeb := parsedBase.Scheme == "http" || parsedBase.Scheme == "https"
+
+	doc, assets, err := parsePage(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filePath, err)
+	}
+
+	var discovered []string
+	for _, a := range assets {
+		resolved, err := resolveURL(parsedBase, a.RawURL)
+		if err != nil {
+			continue
+		}
+
+		switch a.Kind {
+		case AssetLink:
+			if !isWeb {
+				continue
+			}
+			discovered = append(discovered, resolved.String())
+			if linkAllowed == nil || linkAllowed(resolved.Hostname()) {
+				if rel, err := linkRelPath(filePath, targetDir, resolved); err == nil {
+					setAttr(a.Node, a.Attr, rel)
+				}
+			}
+
+		case AssetStylesheet:
+			if rel, ok := downloadStylesheet(a.RawURL, resolved, baseURL, filePath, targetDir, meta); ok {
+				setAttr(a.Node, a.Attr, rel)
+			}
+
+		case AssetSrcset:
+			setAttr(a.Node, a.Attr, rewriteSrcset(a.RawURL, parsedBase, baseURL, filePath, targetDir, meta))
+
+		default: // image, script, iframe, media
+			if rel, ok := downloadAsset(a.RawURL, resolved, baseURL, filePath, targetDir, meta); ok {
+				setAttr(a.Node, a.Attr, rel)
+			}
+		}
+	}
+
+	rewriteInlineCSS(doc, parsedBase, baseURL, filePath, targetDir, meta)
+
+	rendered, err := renderPage(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering %s: %v", filePath, err)
+	}
+
+	if err := os.WriteFile(filePath, []byte(rendered), 0644); err != nil {
+		return nil, fmt.Errorf("error updating file %s: %v", filePath, err)
+	}
+
+	return discovered, nil
+}
+
+// downloadAsset fetches a plain (non-stylesheet) asset - image, script,
+// iframe, media - to the content-addressable path pathMapper assigns it,
+// and returns the path relative to fromFile to use in the rewritten page.
+func downloadAsset(rawURL string, resolved *url.URL, baseURL, fromFile, targetDir string, meta FetchMeta) (string, bool) {
+	localPath := pathMapper.LocalPath(resolved)
+	targetPath := filepath.Join(filepath.Dir(targetDir), localPath)
+
+	if err := downloadFile(rawURL, targetPath, baseURL, meta); err != nil {
+		reporter.Errorf("failed to download %s: %v", rawURL, err)
+		return "", false
+	}
+	reporter.Infof("downloaded %s to %s", rawURL, targetPath)
+
+	rel, err := assetRelPath(fromFile, targetDir, localPath)
+	if err != nil {
+		return "", false
+	}
+	return rel, true
+}
+
+// downloadStylesheet fetches a <link rel=stylesheet> to its mapped local
+// path and recursively rewrites any url(...)/@import references inside it.
+func downloadStylesheet(rawURL string, resolved *url.URL, baseURL, fromFile, targetDir string, meta FetchMeta) (string, bool) {
+	rel, ok := downloadAsset(rawURL, resolved, baseURL, fromFile, targetDir, meta)
+	if !ok {
+		return "", false
+	}
+
+	cssPath := filepath.Join(filepath.Dir(targetDir), pathMapper.LocalPath(resolved))
+	if err := rewriteDownloadedCSS(cssPath, resolved, targetDir, meta); err != nil {
+		reporter.Errorf("failed to rewrite %s: %v", cssPath, err)
+	}
+	return rel, true
+}
+
+// rewriteDownloadedCSS reads back a just-downloaded .css file, downloads
+// every asset it references via url(...)/@import (resolved against the
+// stylesheet's own URL), and rewrites those references to local paths.
+func rewriteDownloadedCSS(cssPath string, cssURL *url.URL, targetDir string, meta FetchMeta) error {
+	body, err := os.ReadFile(cssPath)
+	if err != nil {
+		return err
+	}
+	content := string(body)
+
+	mapping := make(map[string]string)
+	for _, ref := range extractCSSRefs(content) {
+		resolved, err := resolveURL(cssURL, ref.RawURL)
+		if err != nil {
+			continue
+		}
+		if rel, ok := downloadAsset(ref.RawURL, resolved, cssURL.String(), cssPath, targetDir, meta); ok {
+			mapping[ref.RawURL] = rel
+		}
+	}
+	if len(mapping) == 0 {
+		return nil
+	}
+
+	return os.WriteFile(cssPath, []byte(rewriteCSS(content, mapping)), 0644)
+}
+
+// rewriteSrcset resolves and downloads every candidate URL in a srcset
+// attribute value (e.g. "a.jpg 1x, b.jpg 2x"), returning the attribute
+// value rewritten to point at the local copies.
+func rewriteSrcset(raw string, parsedBase *url.URL, baseURL, fromFile, targetDir string, meta FetchMeta) string {
+	candidates := strings.Split(raw, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(strings.TrimSpace(candidate))
+		if len(fields) == 0 {
+			continue
+		}
+		resolved, err := resolveURL(parsedBase, fields[0])
+		if err != nil {
+			continue
+		}
+		rel, ok := downloadAsset(fields[0], resolved, baseURL, fromFile, targetDir, meta)
+		if !ok {
+			continue
+		}
+		fields[0] = rel
+		candidates[i] = " " + strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ",")
+}
+
+// rewriteInlineCSS walks the DOM for style="" attributes and <style>
+// elements, downloading any url(...) references they contain and rewriting
+// them to local paths in place.
+func rewriteInlineCSS(n *html.Node, parsedBase *url.URL, baseURL, fromFile, targetDir string, meta FetchMeta) {
+	if n.Type == html.ElementNode {
+		if style, ok := nodeAttr(n, "style"); ok && strings.Contains(style, "url(") {
+			setAttr(n, "style", rewriteCSSBlob(style, parsedBase, baseURL, fromFile, targetDir, meta))
+		}
+		if n.DataAtom == atom.Style && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+			n.FirstChild.Data = rewriteCSSBlob(n.FirstChild.Data, parsedBase, baseURL, fromFile, targetDir, meta)
+		}
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		rewriteInlineCSS(child, parsedBase, baseURL, fromFile, targetDir, meta)
+	}
+}
+
+// rewriteCSSBlob downloads every url(...)/@import reference in an inline
+// CSS blob (a style="" value or a <style> block's text) and returns it
+// rewritten to point at the local copies.
+func rewriteCSSBlob(cssSrc string, parsedBase *url.URL, baseURL, fromFile, targetDir string, meta FetchMeta) string {
+	mapping := make(map[string]string)
+	for _, ref := range extractCSSRefs(cssSrc) {
+		resolved, err := resolveURL(parsedBase, ref.RawURL)
+		if err != nil {
+			continue
+		}
+		if rel, ok := downloadAsset(ref.RawURL, resolved, baseURL, fromFile, targetDir, meta); ok {
+			mapping[ref.RawURL] = rel
+		}
+	}
+	if len(mapping) == 0 {
+		return cssSrc
+	}
+	return rewriteCSS(cssSrc, mapping)
+}
+
+// assetRelPath computes the path, relative to the directory containing
+// fromFile, of an asset pathMapper has placed at localPath under targetDir's
+// mirror root.
+func assetRelPath(fromFile, targetDir, localPath string) (string, error) {
+	mirrorRoot := filepath.Dir(targetDir)
+	relPath, err := filepath.Rel(filepath.Dir(fromFile), filepath.Join(mirrorRoot, localPath))
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(relPath), nil
+}
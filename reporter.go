@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Verbosity selects how much of a Reporter's non-essential output is shown.
+type Verbosity int
+
+const (
+	VerboseNone Verbosity = iota
+	VerboseV
+	VerboseVV
+)
+
+// FetchMeta carries the crawl context of a single fetch - where it was
+// found and how deep the crawl was at that point - so a Reporter can
+// attribute a fetch event to the page that caused it.
+type FetchMeta struct {
+	SourcePage string
+	Depth      int
+}
+
+// FetchEvent describes the outcome of one URL fetch, as reported to a
+// Reporter after the request (including any retries) has finished.
+type FetchEvent struct {
+	URL        string
+	Status     int // HTTP status code, or 0 if the request never got a response
+	Bytes      int
+	Elapsed    time.Duration
+	SourcePage string
+	Depth      int
+	Err        error
+}
+
+// Reporter is how the rest of the program surfaces progress and errors,
+// instead of calling fmt.Print* directly. It supports a quiet mode, two
+// verbosity levels, and a background per-URL event stream for JSONL
+// logging.
+type Reporter interface {
+	// Infof logs a routine progress message, shown at -v and above.
+	Infof(format string, args ...any)
+	// Debugf logs a detailed trace message, shown at -vv only.
+	Debugf(format string, args ...any)
+	// Errorf logs a failure. Always shown unless quiet.
+	Errorf(format string, args ...any)
+	// Fetched records the outcome of one URL fetch, driving the progress
+	// bar and the JSONL event stream.
+	Fetched(ev FetchEvent)
+	// SetQueueDepth updates the pending-task count shown in the progress
+	// bar.
+	SetQueueDepth(n int)
+	// Close flushes and releases any resources the Reporter holds (e.g.
+	// a JSONL log file).
+	Close() error
+}
+
+// jsonEvent is the JSONL record written per fetched URL when -log-json is
+// set.
+type jsonEvent struct {
+	URL        string `json:"url"`
+	Status     int    `json:"status"`
+	Bytes      int    `json:"bytes"`
+	ElapsedMS  int64  `json:"elapsed_ms"`
+	SourcePage string `json:"source_page,omitempty"`
+	Depth      int    `json:"depth"`
+	Error      string `json:"error,omitempty"`
+}
+
+// consoleReporter is the Reporter used by main: it prints to stdout/stderr
+// (a live progress bar when stdout is a terminal, plain lines otherwise)
+// and optionally mirrors every fetch event as a JSONL record.
+type consoleReporter struct {
+	quiet     bool
+	verbosity Verbosity
+	isTTY     bool
+
+	mu          sync.Mutex
+	queueDepth  int
+	totalBytes  int64
+	urlsFetched int64
+	hostHits    map[string][]time.Time // sliding 1s window, for a per-host rate
+
+	jsonFile *os.File
+	jsonEnc  *json.Encoder
+}
+
+// NewReporter builds the console Reporter. jsonLogPath may be empty to
+// disable the JSONL event stream.
+func NewReporter(quiet bool, verbosity Verbosity, jsonLogPath string) (Reporter, error) {
+	r := &consoleReporter{
+		quiet:     quiet,
+		verbosity: verbosity,
+		isTTY:     isTerminal(os.Stdout),
+		hostHits:  make(map[string][]time.Time),
+	}
+
+	if jsonLogPath != "" {
+		f, err := os.Create(jsonLogPath)
+		if err != nil {
+			return nil, fmt.Errorf("error creating -log-json file %s: %v", jsonLogPath, err)
+		}
+		r.jsonFile = f
+		r.jsonEnc = json.NewEncoder(f)
+	}
+
+	return r, nil
+}
+
+func (r *consoleReporter) Infof(format string, args ...any) {
+	if r.quiet || r.verbosity < VerboseV {
+		return
+	}
+	r.printLine(fmt.Sprintf(format, args...))
+}
+
+func (r *consoleReporter) Debugf(format string, args ...any) {
+	if r.quiet || r.verbosity < VerboseVV {
+		return
+	}
+	r.printLine(fmt.Sprintf(format, args...))
+}
+
+func (r *consoleReporter) Errorf(format string, args ...any) {
+	if r.quiet {
+		return
+	}
+	r.printLine("Error: " + fmt.Sprintf(format, args...))
+}
+
+func (r *consoleReporter) Fetched(ev FetchEvent) {
+	r.mu.Lock()
+	r.totalBytes += int64(ev.Bytes)
+	r.urlsFetched++
+	if host := hostOf(ev.URL); host != "" {
+		r.hostHits[host] = pruneOlderThan(append(r.hostHits[host], time.Now()), time.Second)
+	}
+	r.mu.Unlock()
+
+	if r.jsonEnc != nil {
+		errMsg := ""
+		if ev.Err != nil {
+			errMsg = ev.Err.Error()
+		}
+		r.jsonEnc.Encode(jsonEvent{
+			URL:        ev.URL,
+			Status:     ev.Status,
+			Bytes:      ev.Bytes,
+			ElapsedMS:  ev.Elapsed.Milliseconds(),
+			SourcePage: ev.SourcePage,
+			Depth:      ev.Depth,
+			Error:      errMsg,
+		})
+	}
+
+	if r.quiet {
+		return
+	}
+	if r.isTTY {
+		r.drawProgress(ev)
+		return
+	}
+
+	if ev.Err != nil {
+		r.printLine(fmt.Sprintf("FAIL %s: %v", ev.URL, ev.Err))
+	} else {
+		r.printLine(fmt.Sprintf("%d %s (%d bytes, %s)", ev.Status, ev.URL, ev.Bytes, ev.Elapsed.Round(time.Millisecond)))
+	}
+}
+
+func (r *consoleReporter) SetQueueDepth(n int) {
+	r.mu.Lock()
+	r.queueDepth = n
+	r.mu.Unlock()
+}
+
+func (r *consoleReporter) Close() error {
+	if r.jsonFile == nil {
+		return nil
+	}
+	return r.jsonFile.Close()
+}
+
+// printLine writes a plain line to stdout. When the progress bar is active
+// it's redrawn on the next Fetched call, so the two don't interleave badly.
+func (r *consoleReporter) printLine(s string) {
+	fmt.Println(s)
+}
+
+// drawProgress renders a single-line, carriage-return-updated status: total
+// bytes downloaded, the URL just fetched, the pending queue depth, and that
+// URL's host's current request rate.
+func (r *consoleReporter) drawProgress(ev FetchEvent) {
+	r.mu.Lock()
+	bytes := r.totalBytes
+	queueDepth := r.queueDepth
+	rate := len(r.hostHits[hostOf(ev.URL)])
+	r.mu.Unlock()
+
+	fmt.Printf("\r\033[K%d bytes | queue %d | %s %d/s | %s", bytes, queueDepth, hostOf(ev.URL), rate, ev.URL)
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// pruneOlderThan drops timestamps older than window from the front of a
+// (time-ordered) slice.
+func pruneOlderThan(times []time.Time, window time.Duration) []time.Time {
+	cutoff := time.Now().Add(-window)
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// isTerminal reports whether f appears to be an interactive terminal,
+// without pulling in a terminal-handling dependency.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRules holds the parsed rules that apply to us from a single host's
+// robots.txt: whichever User-agent group matches our configured User-Agent,
+// falling back to "*".
+type robotsRules struct {
+	disallow   []string
+	allow      []string
+	crawlDelay time.Duration
+}
+
+// fetchRobots fetches and parses scheme://host/robots.txt. A missing,
+// non-200, or unparsable robots.txt is treated as "allow everything", which
+// is the standard behavior when no robots.txt is present.
+func fetchRobots(client *http.Client, scheme, host, userAgent string) *robotsRules {
+	req, err := http.NewRequest(http.MethodGet, scheme+"://"+host+"/robots.txt", nil)
+	if err != nil {
+		return &robotsRules{}
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &robotsRules{}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &robotsRules{}
+	}
+
+	return parseRobots(resp.Body, userAgent)
+}
+
+// parseRobots implements enough of the robots.txt format to be useful here:
+// User-agent groups, Disallow/Allow paths, and Crawl-delay. A group
+// matching our own User-Agent takes precedence over "*" when both exist.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	generic := &robotsRules{}
+	specific := &robotsRules{}
+	haveSpecific := false
+
+	var current *robotsRules
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			switch {
+			case value == "*":
+				current = generic
+			case strings.Contains(strings.ToLower(userAgent), strings.ToLower(value)):
+				current = specific
+				haveSpecific = true
+			default:
+				current = nil
+			}
+		case "disallow":
+			if current != nil && value != "" {
+				current.disallow = append(current.disallow, value)
+			}
+		case "allow":
+			if current != nil && value != "" {
+				current.allow = append(current.allow, value)
+			}
+		case "crawl-delay":
+			if current != nil {
+				if secs, err := strconv.ParseFloat(value, 64); err == nil {
+					current.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	if haveSpecific {
+		return specific
+	}
+	return generic
+}
+
+// allowed reports whether path is permitted, using the longest matching
+// Disallow/Allow rule to break ties, per the de facto robots.txt standard.
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	allowMatch, disallowMatch := -1, -1
+	for _, rule := range r.allow {
+		if strings.HasPrefix(path, rule) && len(rule) > allowMatch {
+			allowMatch = len(rule)
+		}
+	}
+	for _, rule := range r.disallow {
+		if strings.HasPrefix(path, rule) && len(rule) > disallowMatch {
+			disallowMatch = len(rule)
+		}
+	}
+	return disallowMatch <= allowMatch
+}
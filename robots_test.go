@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRobotsRulesAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		rule *robotsRules
+		path string
+		want bool
+	}{
+		{"nil rules allow everything", nil, "/anything", true},
+		{"no rules allow everything", &robotsRules{}, "/anything", true},
+		{
+			"disallow with no matching allow",
+			&robotsRules{disallow: []string{"/private"}},
+			"/private/data",
+			false,
+		},
+		{
+			"allow and disallow tie broken by longest match",
+			&robotsRules{disallow: []string{"/private"}, allow: []string{"/private/public"}},
+			"/private/public/page",
+			true,
+		},
+		{
+			"shorter allow loses to longer disallow",
+			&robotsRules{disallow: []string{"/private/secret"}, allow: []string{"/private"}},
+			"/private/secret/file",
+			false,
+		},
+		{
+			"unrelated disallow doesn't block path",
+			&robotsRules{disallow: []string{"/admin"}},
+			"/public",
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.allowed(tt.path); got != tt.want {
+				t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRobotsSpecificOverridesGeneric(t *testing.T) {
+	body := `User-agent: *
+Disallow: /
+Crawl-delay: 1
+
+User-agent: wget11/1.0
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 2
+`
+	rules := parseRobots(strings.NewReader(body), "wget11/1.0")
+
+	if rules.crawlDelay != 2*time.Second {
+		t.Errorf("crawlDelay = %v, want 2s (specific group should win)", rules.crawlDelay)
+	}
+	if !rules.allowed("/public") {
+		t.Error("expected /public to be allowed under the specific group, not the generic disallow-all")
+	}
+	if rules.allowed("/private/secret") {
+		t.Error("expected /private/secret to be disallowed under the specific group")
+	}
+	if !rules.allowed("/private/public") {
+		t.Error("expected /private/public to be allowed via the longer Allow match")
+	}
+}
+
+func TestParseRobotsFallsBackToGeneric(t *testing.T) {
+	body := `User-agent: *
+Disallow: /private
+`
+	rules := parseRobots(strings.NewReader(body), "wget11/1.0")
+
+	if rules.allowed("/private/file") {
+		t.Error("expected the generic group to apply when no specific group exists")
+	}
+	if !rules.allowed("/public") {
+		t.Error("expected /public to remain allowed")
+	}
+}